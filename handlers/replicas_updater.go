@@ -3,14 +3,18 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
 	"github.com/gorilla/mux"
 )
@@ -19,11 +23,98 @@ import (
 type ScaleServiceRequest struct {
 	ServiceName string `json:"serviceName"`
 	Replicas    uint64 `json:"replicas"`
+
+	// UpdateParallelism overrides com.openfaas.scale.update.parallelism when set
+	UpdateParallelism *uint64 `json:"updateParallelism,omitempty"`
+
+	// UpdateDelay overrides com.openfaas.scale.update.delay when set, e.g. "10s"
+	UpdateDelay string `json:"updateDelay,omitempty"`
+
+	// UpdateFailureAction overrides com.openfaas.scale.update.failure_action when set, "pause" or "continue"
+	UpdateFailureAction string `json:"updateFailureAction,omitempty"`
+
+	// UpdateMonitor overrides com.openfaas.scale.update.monitor when set, e.g. "20s"
+	UpdateMonitor string `json:"updateMonitor,omitempty"`
+
+	// UpdateMaxFailureRatio overrides com.openfaas.scale.update.max_failure_ratio when set
+	UpdateMaxFailureRatio *float32 `json:"updateMaxFailureRatio,omitempty"`
+
+	// Wait, if true (or ?wait=true is set on the URL), blocks until the update converges
+	Wait bool `json:"wait,omitempty"`
+}
+
+// UpdateConvergenceResult reports whether a service update reached a converged state
+// and, if not, what state it is stuck in.
+type UpdateConvergenceResult struct {
+	State       string    `json:"state"`
+	Message     string    `json:"message"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+// DefaultUpdateWaitTimeout is how long ReplicaUpdater polls for convergence when wait=true
+const DefaultUpdateWaitTimeout = 2 * time.Minute
+
+// DefaultUpdatePollInterval is how often ReplicaUpdater polls ServiceInspectWithRaw when wait=true
+const DefaultUpdatePollInterval = 1 * time.Second
+
+// ServiceUpdateConfig carries request-body overrides of the rolling-update tuning
+// applied to a scale request. Unset fields fall back to the com.openfaas.scale.update.*
+// labels on the service.
+type ServiceUpdateConfig struct {
+	Parallelism     *uint64
+	Delay           *time.Duration
+	FailureAction   string
+	Monitor         *time.Duration
+	MaxFailureRatio *float32
+}
+
+// parseUpdateConfigOverride builds a ServiceUpdateConfig from the optional rolling-update
+// fields on a ScaleServiceRequest, returning an error if a duration field cannot be parsed.
+func parseUpdateConfigOverride(req ScaleServiceRequest) (ServiceUpdateConfig, error) {
+	override := ServiceUpdateConfig{
+		Parallelism:     req.UpdateParallelism,
+		FailureAction:   req.UpdateFailureAction,
+		MaxFailureRatio: req.UpdateMaxFailureRatio,
+	}
+
+	if len(req.UpdateDelay) > 0 {
+		delay, err := time.ParseDuration(req.UpdateDelay)
+		if err != nil {
+			return ServiceUpdateConfig{}, fmt.Errorf("updateDelay: %s", err.Error())
+		}
+		override.Delay = &delay
+	}
+
+	if len(req.UpdateMonitor) > 0 {
+		monitor, err := time.ParseDuration(req.UpdateMonitor)
+		if err != nil {
+			return ServiceUpdateConfig{}, fmt.Errorf("updateMonitor: %s", err.Error())
+		}
+		override.Monitor = &monitor
+	}
+
+	return override, nil
 }
 
+// UpdateParallelismLabel label indicating the rolling-update batch size for a function
+const UpdateParallelismLabel = "com.openfaas.scale.update.parallelism"
+
+// UpdateDelayLabel label indicating the delay between rolling-update batches, e.g. "10s"
+const UpdateDelayLabel = "com.openfaas.scale.update.delay"
+
+// UpdateFailureActionLabel label indicating what to do when a rolling-update task fails, "pause" or "continue"
+const UpdateFailureActionLabel = "com.openfaas.scale.update.failure_action"
+
+// UpdateMonitorLabel label indicating how long to monitor each updated task for failure, e.g. "20s"
+const UpdateMonitorLabel = "com.openfaas.scale.update.monitor"
+
+// UpdateMaxFailureRatioLabel label indicating the failure ratio tolerated during a rolling update
+const UpdateMaxFailureRatioLabel = "com.openfaas.scale.update.max_failure_ratio"
+
 // ReplicaUpdater updates a function
 func ReplicaUpdater(c *client.Client) http.HandlerFunc {
-	serviceQuery := NewSwarmServiceQuery(c)
+	serviceQuery := NewCoalescingServiceQuery(NewSwarmServiceQuery(c), DefaultScaleDebounceWindow)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -52,30 +143,156 @@ func ReplicaUpdater(c *client.Client) http.HandlerFunc {
 
 		log.Printf("Scaling %s to %d replicas", functionName, req.Replicas)
 
-		postStartTs, postEndTs, scaleErr := scaleService(functionName, req.Replicas, serviceQuery)
+		updateConfig, updateConfigErr := parseUpdateConfigOverride(req)
+		if updateConfigErr != nil {
+			msg := fmt.Sprintf("Invalid update config: %s", updateConfigErr.Error())
+
+			log.Println(msg)
+
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(msg))
+			return
+		}
+
+		postStartTs, postEndTs, clampedReplicas, wasClamped, scaleErr := scaleService(functionName, req.Replicas, updateConfig, serviceQuery)
+
+		if wasClamped {
+			msg := fmt.Sprintf("requested replicas %d violates the min/max scale labels for %s, clamped to %d", req.Replicas, functionName, clampedReplicas)
+
+			log.Println(msg)
+
+			body, _ := json.Marshal(struct {
+				RequestedReplicas uint64 `json:"requestedReplicas"`
+				ClampedReplicas   uint64 `json:"clampedReplicas"`
+				Message           string `json:"message"`
+			}{req.Replicas, clampedReplicas, msg})
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(body)
+			return
+		}
 
 		log.Printf(fmt.Sprintf("Adding Headers in response: %d %d", postStartTs.UTC().UnixNano(), postEndTs.UTC().UnixNano()))
 		w.Header().Add("X-Scale-Post-Send-Time", fmt.Sprintf("%d", postStartTs.UTC().UnixNano()))
 		w.Header().Add("X-Scale-Post-Response-Time", fmt.Sprintf("%d", postEndTs.UTC().UnixNano()))
-		
+
 		if scaleErr != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			if errors.Is(scaleErr, ErrServiceModeGlobal) {
+				w.WriteHeader(http.StatusBadRequest)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
 			w.Write([]byte(scaleErr.Error()))
 			log.Println(scaleErr.Error())
 			return
 		}
 
+		wait := req.Wait || r.URL.Query().Get("wait") == "true"
+		if !wait {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		waitStartTs := time.Now()
+		result, waitErr := serviceQuery.WaitForUpdate(functionName, clampedReplicas, DefaultUpdateWaitTimeout, DefaultUpdatePollInterval)
+		waitEndTs := time.Now()
+
+		w.Header().Add("X-Scale-Wait-Poll-Interval", DefaultUpdatePollInterval.String())
+		w.Header().Add("X-Scale-Wait-Total-Time", waitEndTs.Sub(waitStartTs).String())
+		w.Header().Set("Content-Type", "application/json")
+
+		if waitErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(waitErr.Error()))
+			log.Println(waitErr.Error())
+			return
+		}
+
+		body, _ := json.Marshal(result)
+
+		if result.State == string(swarm.UpdateStateCompleted) {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			// Paused, RollbackCompleted, or a non-terminal state left over from a timed-out wait
+			w.WriteHeader(http.StatusConflict)
+		}
+		w.Write(body)
+	}
+}
+
+// RollbackService reverts a function to its previous spec
+func RollbackService(c *client.Client) http.HandlerFunc {
+	serviceQuery := NewSwarmServiceQuery(c)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		functionName := vars["name"]
+
+		log.Printf("RollbackService - rolling back function: %s\n", functionName)
+
+		postStartTs, postEndTs, rollbackErr := rollbackService(functionName, serviceQuery)
+
+		log.Printf(fmt.Sprintf("Adding Headers in response: %d %d", postStartTs.UTC().UnixNano(), postEndTs.UTC().UnixNano()))
+		w.Header().Add("X-Scale-Post-Send-Time", fmt.Sprintf("%d", postStartTs.UTC().UnixNano()))
+		w.Header().Add("X-Scale-Post-Response-Time", fmt.Sprintf("%d", postEndTs.UTC().UnixNano()))
+
+		if rollbackErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(rollbackErr.Error()))
+			log.Println(rollbackErr.Error())
+			return
+		}
+
 		w.WriteHeader(http.StatusAccepted)
 	}
 }
 
-func scaleService(serviceName string, newReplicas uint64, service ServiceQuery) (time.Time, time.Time, error) {
+func rollbackService(serviceName string, service ServiceQuery) (time.Time, time.Time, error) {
 	var postStartTs time.Time
 	var postEndTs time.Time
 	var err error
 
 	if len(serviceName) > 0 {
-		startTs, endTs, updateErr := service.SetReplicas(serviceName, newReplicas)
+		startTs, endTs, rollbackErr := service.Rollback(serviceName)
+		if rollbackErr != nil {
+			err = rollbackErr
+		}
+		postStartTs = startTs
+		postEndTs = endTs
+	}
+
+	return postStartTs, postEndTs, err
+}
+
+// scaleService checks newReplicas against the function's [minReplicas, maxReplicas] label
+// constraints. An in-range count is applied as is; an out-of-range count is not applied
+// at all, and the value it clamps to is reported back with wasClamped set so the caller
+// can reject the request.
+func scaleService(serviceName string, newReplicas uint64, updateConfig ServiceUpdateConfig, service ServiceQuery) (postStartTs time.Time, postEndTs time.Time, clampedReplicas uint64, wasClamped bool, err error) {
+	clampedReplicas = newReplicas
+
+	if len(serviceName) > 0 {
+		_, maxReplicas, minReplicas, getErr := service.GetReplicas(serviceName)
+		if getErr != nil {
+			err = getErr
+			return
+		}
+
+		if newReplicas < minReplicas {
+			clampedReplicas = minReplicas
+			wasClamped = true
+		} else if newReplicas > maxReplicas {
+			clampedReplicas = maxReplicas
+			wasClamped = true
+		}
+
+		if wasClamped {
+			return
+		}
+
+		startTs, endTs, updateErr := service.SetReplicas(serviceName, clampedReplicas, updateConfig)
 		if updateErr != nil {
 			err = updateErr
 		}
@@ -83,7 +300,7 @@ func scaleService(serviceName string, newReplicas uint64, service ServiceQuery)
 		postEndTs = endTs
 	}
 
-	return postStartTs, postEndTs, err
+	return
 }
 
 // DefaultMaxReplicas is the amount of replicas a service will auto-scale up to.
@@ -95,10 +312,16 @@ const MinScaleLabel = "com.openfaas.scale.min"
 // MaxScaleLabel label indicating max scale for a function
 const MaxScaleLabel = "com.openfaas.scale.max"
 
+// ErrServiceModeGlobal is returned when a replica operation is attempted against a
+// service running in Swarm global mode, which has no notion of a replica count.
+var ErrServiceModeGlobal = errors.New("service is running in global mode and does not support replica scaling")
+
 // ServiceQuery provides interface for replica querying/setting
 type ServiceQuery interface {
 	GetReplicas(service string) (currentReplicas uint64, maxReplicas uint64, minReplicas uint64, err error)
-	SetReplicas(service string, count uint64) (postStartTs time.Time, postEndTs time.Time, err error)
+	SetReplicas(service string, count uint64, updateConfig ServiceUpdateConfig) (postStartTs time.Time, postEndTs time.Time, err error)
+	Rollback(service string) (postStartTs time.Time, postEndTs time.Time, err error)
+	WaitForUpdate(service string, desiredReplicas uint64, timeout time.Duration, pollInterval time.Duration) (UpdateConvergenceResult, error)
 }
 
 // NewSwarmServiceQuery create new Docker Swarm implementation
@@ -113,6 +336,133 @@ type SwarmServiceQuery struct {
 	c *client.Client
 }
 
+// DefaultScaleDebounceWindow is how long CoalescingServiceQuery waits to collect
+// concurrent SetReplicas calls for the same service before issuing a single update.
+const DefaultScaleDebounceWindow = 100 * time.Millisecond
+
+// scaleResult is the outcome of a coalesced SetReplicas round-trip, delivered to every
+// waiter that coalesced into it.
+type scaleResult struct {
+	postStartTs time.Time
+	postEndTs   time.Time
+	err         error
+}
+
+// pendingScale accumulates the latest desired replica count and update config for a
+// service while a coalesced SetReplicas round-trip is being debounced, along with the
+// waiters to notify once it completes. Once closed is true, settlePendingScale has
+// already taken its snapshot of waiters and this pendingScale can no longer accept
+// late joiners; callers must start a fresh one instead.
+type pendingScale struct {
+	mu           sync.Mutex
+	desired      uint64
+	updateConfig ServiceUpdateConfig
+	waiters      []chan scaleResult
+	closed       bool
+}
+
+// CoalescingServiceQuery wraps a ServiceQuery so that concurrent SetReplicas calls for
+// the same service within debounce collapse into a single inspect+update round-trip
+// against the underlying query, rather than one per caller.
+type CoalescingServiceQuery struct {
+	inner    ServiceQuery
+	debounce time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*pendingScale
+}
+
+// NewCoalescingServiceQuery wraps inner with per-service scale request coalescing
+func NewCoalescingServiceQuery(inner ServiceQuery, debounce time.Duration) ServiceQuery {
+	return &CoalescingServiceQuery{
+		inner:    inner,
+		debounce: debounce,
+		pending:  map[string]*pendingScale{},
+	}
+}
+
+// GetReplicas delegates straight through, reads are not coalesced
+func (c *CoalescingServiceQuery) GetReplicas(serviceName string) (uint64, uint64, uint64, error) {
+	return c.inner.GetReplicas(serviceName)
+}
+
+// SetReplicas registers count as the latest desired replica count for serviceName and
+// waits for the pending coalesced update (starting one if none is in flight) to complete.
+// When several calls coalesce, the count and update config of the last one to register
+// are applied, and every caller receives the result of that single update.
+// c.mu and p.mu are locked in separate critical sections, so a pendingScale looked up
+// under c.mu can have already been settled by the time this call reaches p.mu; closed
+// is checked under p.mu, in the same lock settlePendingScale uses to snapshot waiters,
+// so a late joiner always retries onto a fresh pendingScale instead of appending to one
+// nobody will ever notify.
+func (c *CoalescingServiceQuery) SetReplicas(serviceName string, count uint64, updateConfig ServiceUpdateConfig) (time.Time, time.Time, error) {
+	for {
+		c.mu.Lock()
+		p, inFlight := c.pending[serviceName]
+		if !inFlight {
+			p = &pendingScale{}
+			c.pending[serviceName] = p
+		}
+		c.mu.Unlock()
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			continue
+		}
+		p.desired = count
+		p.updateConfig = updateConfig
+		waitCh := make(chan scaleResult, 1)
+		p.waiters = append(p.waiters, waitCh)
+		p.mu.Unlock()
+
+		if !inFlight {
+			go c.settlePendingScale(serviceName, p)
+		}
+
+		result := <-waitCh
+
+		return result.postStartTs, result.postEndTs, result.err
+	}
+}
+
+// settlePendingScale waits out the debounce window, then issues a single SetReplicas
+// call against the underlying ServiceQuery using the newest desired value and notifies
+// every waiter that coalesced into it. Marking p closed happens in the same p.mu
+// critical section as taking the waiters snapshot, so SetReplicas can never observe a
+// pendingScale as open after its waiters have already been captured here.
+func (c *CoalescingServiceQuery) settlePendingScale(serviceName string, p *pendingScale) {
+	time.Sleep(c.debounce)
+
+	c.mu.Lock()
+	delete(c.pending, serviceName)
+	c.mu.Unlock()
+
+	p.mu.Lock()
+	desired := p.desired
+	updateConfig := p.updateConfig
+	waiters := p.waiters
+	p.closed = true
+	p.mu.Unlock()
+
+	postStartTs, postEndTs, err := c.inner.SetReplicas(serviceName, desired, updateConfig)
+
+	for _, waitCh := range waiters {
+		waitCh <- scaleResult{postStartTs: postStartTs, postEndTs: postEndTs, err: err}
+		close(waitCh)
+	}
+}
+
+// Rollback delegates straight through, a rollback is a one-off operation and is not coalesced
+func (c *CoalescingServiceQuery) Rollback(serviceName string) (time.Time, time.Time, error) {
+	return c.inner.Rollback(serviceName)
+}
+
+// WaitForUpdate delegates straight through to the underlying ServiceQuery
+func (c *CoalescingServiceQuery) WaitForUpdate(serviceName string, desiredReplicas uint64, timeout time.Duration, pollInterval time.Duration) (UpdateConvergenceResult, error) {
+	return c.inner.WaitForUpdate(serviceName, desiredReplicas, timeout, pollInterval)
+}
+
 // GetReplicas replica count for function
 func (s SwarmServiceQuery) GetReplicas(serviceName string) (uint64, uint64, uint64, error) {
 	var err error
@@ -128,6 +478,10 @@ func (s SwarmServiceQuery) GetReplicas(serviceName string) (uint64, uint64, uint
 	service, _, err := s.c.ServiceInspectWithRaw(context.Background(), serviceName, opts)
 
 	if err == nil {
+		if service.Spec.Mode.Global != nil {
+			return 0, 0, 0, ErrServiceModeGlobal
+		}
+
 		currentReplicas = *service.Spec.Mode.Replicated.Replicas
 
 		minScale := service.Spec.Annotations.Labels[MinScaleLabel]
@@ -143,7 +497,7 @@ func (s SwarmServiceQuery) GetReplicas(serviceName string) (uint64, uint64, uint
 		}
 
 		if len(minScale) > 0 {
-			labelValue, err := strconv.Atoi(maxScale)
+			labelValue, err := strconv.Atoi(minScale)
 			if err != nil {
 				log.Printf("Bad replica count: %s, should be uint", minScale)
 			} else {
@@ -156,7 +510,7 @@ func (s SwarmServiceQuery) GetReplicas(serviceName string) (uint64, uint64, uint
 }
 
 // SetReplicas update the replica count
-func (s SwarmServiceQuery) SetReplicas(serviceName string, count uint64) (time.Time, time.Time, error) {
+func (s SwarmServiceQuery) SetReplicas(serviceName string, count uint64, updateConfig ServiceUpdateConfig) (time.Time, time.Time, error) {
 	opts := types.ServiceInspectOptions{
 		InsertDefaults: true,
 	}
@@ -167,7 +521,13 @@ func (s SwarmServiceQuery) SetReplicas(serviceName string, count uint64) (time.T
 	service, _, err := s.c.ServiceInspectWithRaw(context.Background(), serviceName, opts)
 	if err == nil {
 
+		if service.Spec.Mode.Global != nil {
+			return postStartTs, postEndTs, ErrServiceModeGlobal
+		}
+
 		service.Spec.Mode.Replicated.Replicas = &count
+		service.Spec.UpdateConfig = buildUpdateConfig(service.Spec.UpdateConfig, service.Spec.Annotations.Labels, updateConfig)
+
 		updateOpts := types.ServiceUpdateOptions{}
 		updateOpts.RegistryAuthFrom = types.RegistryAuthFromSpec
 
@@ -181,3 +541,185 @@ func (s SwarmServiceQuery) SetReplicas(serviceName string, count uint64) (time.T
 
 	return postStartTs, postEndTs, err
 }
+
+// WaitForUpdate polls ServiceInspectWithRaw until the service's UpdateStatus converges
+// to UpdateStateCompleted, UpdateStatePaused or UpdateStateRollbackCompleted, or until
+// timeout elapses. Swarm only drives UpdateStatus for a genuine rolling update (a task
+// template diff); a plain replica-count change leaves it nil, so convergence there is
+// confirmed instead by counting actually-running tasks against desiredReplicas.
+func (s SwarmServiceQuery) WaitForUpdate(serviceName string, desiredReplicas uint64, timeout time.Duration, pollInterval time.Duration) (UpdateConvergenceResult, error) {
+	opts := types.ServiceInspectOptions{
+		InsertDefaults: true,
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		service, _, err := s.c.ServiceInspectWithRaw(context.Background(), serviceName, opts)
+		if err != nil {
+			return UpdateConvergenceResult{}, err
+		}
+
+		if service.UpdateStatus != nil {
+			switch service.UpdateStatus.State {
+			case swarm.UpdateStateCompleted, swarm.UpdateStatePaused, swarm.UpdateStateRollbackCompleted:
+				return UpdateConvergenceResult{
+					State:       string(service.UpdateStatus.State),
+					Message:     service.UpdateStatus.Message,
+					StartedAt:   timeOrZero(service.UpdateStatus.StartedAt),
+					CompletedAt: timeOrZero(service.UpdateStatus.CompletedAt),
+				}, nil
+			}
+
+			if time.Now().After(deadline) {
+				return UpdateConvergenceResult{
+					State:     string(service.UpdateStatus.State),
+					Message:   fmt.Sprintf("timed out after %s waiting for convergence", timeout),
+					StartedAt: timeOrZero(service.UpdateStatus.StartedAt),
+				}, nil
+			}
+		} else {
+			converged, runningTasks, taskErr := s.replicasConverged(serviceName, desiredReplicas)
+			if taskErr != nil {
+				return UpdateConvergenceResult{}, taskErr
+			}
+
+			if converged {
+				return UpdateConvergenceResult{
+					State: string(swarm.UpdateStateCompleted),
+				}, nil
+			}
+
+			if time.Now().After(deadline) {
+				return UpdateConvergenceResult{
+					State:   "pending",
+					Message: fmt.Sprintf("timed out after %s waiting for %d/%d replicas to converge", timeout, runningTasks, desiredReplicas),
+				}, nil
+			}
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// replicasConverged reports whether exactly desiredReplicas tasks for serviceName have
+// actually reached the running state, used to confirm convergence for plain replica-count
+// changes where Swarm leaves UpdateStatus unset. An exact match is required rather than
+// "at least", since during a scale-down the original, excess tasks are still reported as
+// running for a while after ServiceUpdate returns, before Swarm has torn them down.
+func (s SwarmServiceQuery) replicasConverged(serviceName string, desiredReplicas uint64) (bool, uint64, error) {
+	tasks, err := s.c.TaskList(context.Background(), types.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("service", serviceName)),
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	running := countRunningTasks(tasks)
+
+	return running == desiredReplicas, running, nil
+}
+
+// countRunningTasks counts how many tasks have reached TaskStateRunning.
+func countRunningTasks(tasks []swarm.Task) uint64 {
+	var running uint64
+	for _, task := range tasks {
+		if task.Status.State == swarm.TaskStateRunning {
+			running++
+		}
+	}
+	return running
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// Rollback reverts the service to its PreviousSpec
+func (s SwarmServiceQuery) Rollback(serviceName string) (time.Time, time.Time, error) {
+	opts := types.ServiceInspectOptions{
+		InsertDefaults: true,
+	}
+
+	var postStartTs time.Time
+	var postEndTs time.Time
+
+	service, _, err := s.c.ServiceInspectWithRaw(context.Background(), serviceName, opts)
+	if err == nil {
+
+		updateOpts := types.ServiceUpdateOptions{}
+		updateOpts.RegistryAuthFrom = types.RegistryAuthFromSpec
+		updateOpts.Rollback = "previous"
+
+		postStartTs = time.Now()
+		_, updateErr := s.c.ServiceUpdate(context.Background(), service.ID, service.Version, service.Spec, updateOpts)
+		postEndTs = time.Now()
+		if updateErr != nil {
+			err = updateErr
+		}
+	}
+
+	return postStartTs, postEndTs, err
+}
+
+// buildUpdateConfig merges the com.openfaas.scale.update.* labels on a function with any
+// request-body overrides to produce the swarm.UpdateConfig applied during a replica change.
+// Override fields take precedence over labels; anything left unset keeps the service's
+// current setting, which is Swarm's own default when the service does not set one.
+func buildUpdateConfig(current *swarm.UpdateConfig, labels map[string]string, override ServiceUpdateConfig) *swarm.UpdateConfig {
+	config := &swarm.UpdateConfig{}
+	if current != nil {
+		*config = *current
+	}
+
+	if override.Parallelism != nil {
+		config.Parallelism = *override.Parallelism
+	} else if labelValue := labels[UpdateParallelismLabel]; len(labelValue) > 0 {
+		if parsed, err := strconv.ParseUint(labelValue, 10, 64); err != nil {
+			log.Printf("Bad update parallelism: %s, should be uint", labelValue)
+		} else {
+			config.Parallelism = parsed
+		}
+	}
+
+	if override.Delay != nil {
+		config.Delay = *override.Delay
+	} else if labelValue := labels[UpdateDelayLabel]; len(labelValue) > 0 {
+		if parsed, err := time.ParseDuration(labelValue); err != nil {
+			log.Printf("Bad update delay: %s, should be a duration", labelValue)
+		} else {
+			config.Delay = parsed
+		}
+	}
+
+	if len(override.FailureAction) > 0 {
+		config.FailureAction = override.FailureAction
+	} else if labelValue := labels[UpdateFailureActionLabel]; len(labelValue) > 0 {
+		config.FailureAction = labelValue
+	}
+
+	if override.Monitor != nil {
+		config.Monitor = *override.Monitor
+	} else if labelValue := labels[UpdateMonitorLabel]; len(labelValue) > 0 {
+		if parsed, err := time.ParseDuration(labelValue); err != nil {
+			log.Printf("Bad update monitor: %s, should be a duration", labelValue)
+		} else {
+			config.Monitor = parsed
+		}
+	}
+
+	if override.MaxFailureRatio != nil {
+		config.MaxFailureRatio = *override.MaxFailureRatio
+	} else if labelValue := labels[UpdateMaxFailureRatioLabel]; len(labelValue) > 0 {
+		if parsed, err := strconv.ParseFloat(labelValue, 32); err != nil {
+			log.Printf("Bad update max failure ratio: %s, should be a float", labelValue)
+		} else {
+			config.MaxFailureRatio = float32(parsed)
+		}
+	}
+
+	return config
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// fakeServiceQuery is a minimal in-memory ServiceQuery used to exercise
+// CoalescingServiceQuery and scaleService without a Docker Swarm client.
+type fakeServiceQuery struct {
+	setReplicasCalls int32
+
+	currentReplicas uint64
+	minReplicas     uint64
+	maxReplicas     uint64
+	getReplicasErr  error
+}
+
+func (f *fakeServiceQuery) GetReplicas(service string) (uint64, uint64, uint64, error) {
+	if f.getReplicasErr != nil {
+		return 0, 0, 0, f.getReplicasErr
+	}
+	return f.currentReplicas, f.maxReplicas, f.minReplicas, nil
+}
+
+func (f *fakeServiceQuery) SetReplicas(service string, count uint64, updateConfig ServiceUpdateConfig) (time.Time, time.Time, error) {
+	atomic.AddInt32(&f.setReplicasCalls, 1)
+	return time.Now(), time.Now(), nil
+}
+
+func (f *fakeServiceQuery) Rollback(service string) (time.Time, time.Time, error) {
+	return time.Time{}, time.Time{}, nil
+}
+
+func (f *fakeServiceQuery) WaitForUpdate(service string, desiredReplicas uint64, timeout time.Duration, pollInterval time.Duration) (UpdateConvergenceResult, error) {
+	return UpdateConvergenceResult{State: "completed"}, nil
+}
+
+// TestCoalescingServiceQuerySetReplicasConcurrent guards against a late joiner
+// appending to a pendingScale whose waiters have already been snapshotted by
+// settlePendingScale: every concurrent caller for the same service must still
+// observe a result instead of blocking forever. Run with -race.
+func TestCoalescingServiceQuerySetReplicasConcurrent(t *testing.T) {
+	inner := &fakeServiceQuery{}
+	coalescer := NewCoalescingServiceQuery(inner, 20*time.Millisecond)
+
+	const callers = 50
+
+	var wg sync.WaitGroup
+	wg.Add(callers)
+
+	for i := 0; i < callers; i++ {
+		go func(n int) {
+			defer wg.Done()
+			if _, _, err := coalescer.SetReplicas("test-service", uint64(n), ServiceUpdateConfig{}); err != nil {
+				t.Errorf("SetReplicas returned error: %v", err)
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not all concurrent SetReplicas calls returned, a late joiner likely leaked on a closed pendingScale")
+	}
+
+	if calls := atomic.LoadInt32(&inner.setReplicasCalls); calls == 0 {
+		t.Fatalf("expected SetReplicas to be called against the inner ServiceQuery at least once, got %d", calls)
+	}
+}
+
+// TestScaleServiceClamp covers scaleService's min/max clamp decision. The fake returns
+// min/max directly, so the parsing of the scale labels in GetReplicas is not exercised.
+func TestScaleServiceClamp(t *testing.T) {
+	cases := []struct {
+		name            string
+		newReplicas     uint64
+		minReplicas     uint64
+		maxReplicas     uint64
+		wantClamped     uint64
+		wantWasClamped  bool
+		wantSetReplicas bool
+	}{
+		{"within range", 5, 1, 20, 5, false, true},
+		{"below min", 0, 1, 20, 1, true, false},
+		{"above max", 25, 1, 20, 20, true, false},
+		{"equals min", 1, 1, 20, 1, false, true},
+		{"equals max", 20, 1, 20, 20, false, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			inner := &fakeServiceQuery{minReplicas: tc.minReplicas, maxReplicas: tc.maxReplicas}
+
+			_, _, clamped, wasClamped, err := scaleService("test-service", tc.newReplicas, ServiceUpdateConfig{}, inner)
+			if err != nil {
+				t.Fatalf("scaleService returned error: %v", err)
+			}
+
+			if clamped != tc.wantClamped {
+				t.Errorf("clampedReplicas = %d, want %d", clamped, tc.wantClamped)
+			}
+			if wasClamped != tc.wantWasClamped {
+				t.Errorf("wasClamped = %v, want %v", wasClamped, tc.wantWasClamped)
+			}
+
+			gotSetReplicas := atomic.LoadInt32(&inner.setReplicasCalls) > 0
+			if gotSetReplicas != tc.wantSetReplicas {
+				t.Errorf("SetReplicas called = %v, want %v", gotSetReplicas, tc.wantSetReplicas)
+			}
+		})
+	}
+}
+
+// TestCountRunningTasks covers the pure task-counting logic replicasConverged relies on
+// to decide whether a scale has actually converged.
+func TestCountRunningTasks(t *testing.T) {
+	task := func(state swarm.TaskState) swarm.Task {
+		return swarm.Task{Status: swarm.TaskStatus{State: state}}
+	}
+
+	cases := []struct {
+		name  string
+		tasks []swarm.Task
+		want  uint64
+	}{
+		{"no tasks", nil, 0},
+		{"all running", []swarm.Task{task(swarm.TaskStateRunning), task(swarm.TaskStateRunning)}, 2},
+		{"mixed states", []swarm.Task{task(swarm.TaskStateRunning), task(swarm.TaskStateShutdown), task(swarm.TaskStateNew)}, 1},
+		{"none running", []swarm.Task{task(swarm.TaskStateShutdown), task(swarm.TaskStateFailed)}, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := countRunningTasks(tc.tasks); got != tc.want {
+				t.Errorf("countRunningTasks() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestReplicasConvergedDecision restates, as a table, the exact-match rule that
+// replicasConverged applies so that a scale-down with excess tasks still running is
+// not reported as converged. It compares running and desired itself and does not call
+// replicasConverged, which needs a Docker client.
+func TestReplicasConvergedDecision(t *testing.T) {
+	cases := []struct {
+		name          string
+		running       uint64
+		desired       uint64
+		wantConverged bool
+	}{
+		{"scale down, excess tasks still running", 5, 2, false},
+		{"scale down, converged", 2, 2, true},
+		{"scale up, not yet converged", 2, 5, false},
+		{"scale up, converged", 5, 5, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if converged := tc.running == tc.desired; converged != tc.wantConverged {
+				t.Errorf("running == desired = %v, want %v", converged, tc.wantConverged)
+			}
+		})
+	}
+}